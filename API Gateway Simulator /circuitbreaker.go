@@ -0,0 +1,225 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CircuitState is one state in a provider's breaker state machine.
+type CircuitState int32
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the label value used on the circuit Prometheus metrics.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+const (
+	circuitWindowSize       = 20              // rolling window of recent calls considered
+	circuitErrorThreshold   = 0.5              // failure fraction within the window that opens the circuit
+	circuitOpenBaseDuration = 30 * time.Second // Open duration before the first half-open probe
+	circuitOpenMaxDuration  = 5 * time.Minute  // cap on the escalating backoff between re-opens
+	circuitHalfOpenProbes   = 3                // max concurrent requests admitted while half-open
+	circuitHalfOpenToClose  = 3                // consecutive probe successes required to close
+)
+
+// CircuitBreaker implements a Closed -> Open -> HalfOpen -> Closed state
+// machine for a single provider. It replaces the old "cooldown expires,
+// instantly treat as healthy" logic that caused thundering herd against
+// marginally-healthy upstreams: recovery is gated behind a handful of
+// half-open probes instead of reopening the floodgates at once.
+type CircuitBreaker struct {
+	providerID string
+
+	state int32 // CircuitState, atomic
+
+	mu               sync.Mutex
+	results          [circuitWindowSize]bool
+	resultCount      int
+	nextResultIdx    int
+	openUntil        time.Time
+	consecutiveOpens int
+	halfOpenSuccess  int
+
+	halfOpenPermits int32 // atomic semaphore guarding half-open admission
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for a provider.
+func NewCircuitBreaker(providerID string) *CircuitBreaker {
+	cb := &CircuitBreaker{providerID: providerID}
+	cb.setState(CircuitClosed)
+	return cb
+}
+
+// Allow reports whether a request may be sent to the provider right now. If
+// admitted while half-open, done must be called exactly once when the
+// request completes to release its probe permit.
+func (cb *CircuitBreaker) Allow() (admit bool, done func()) {
+	switch CircuitState(atomic.LoadInt32(&cb.state)) {
+	case CircuitOpen:
+		cb.mu.Lock()
+		expired := time.Now().After(cb.openUntil)
+		cb.mu.Unlock()
+		if !expired {
+			return false, func() {}
+		}
+		cb.transitionToHalfOpen()
+		return cb.admitHalfOpen()
+	case CircuitHalfOpen:
+		return cb.admitHalfOpen()
+	default:
+		return true, func() {}
+	}
+}
+
+// admitHalfOpen tries to acquire one of the K half-open probe permits.
+func (cb *CircuitBreaker) admitHalfOpen() (bool, func()) {
+	if atomic.AddInt32(&cb.halfOpenPermits, -1) < 0 {
+		atomic.AddInt32(&cb.halfOpenPermits, 1)
+		return false, func() {}
+	}
+	return true, func() { atomic.AddInt32(&cb.halfOpenPermits, 1) }
+}
+
+// RecordResult folds a completed call's outcome into the breaker and drives
+// state transitions.
+func (cb *CircuitBreaker) RecordResult(failed bool) {
+	if CircuitState(atomic.LoadInt32(&cb.state)) == CircuitHalfOpen {
+		cb.recordHalfOpenResult(failed)
+		return
+	}
+	cb.recordClosedResult(failed)
+}
+
+// recordClosedResult appends to the rolling window and opens the circuit
+// once a full window has been observed with too high an error rate.
+func (cb *CircuitBreaker) recordClosedResult(failed bool) {
+	cb.mu.Lock()
+	cb.results[cb.nextResultIdx] = failed
+	cb.nextResultIdx = (cb.nextResultIdx + 1) % circuitWindowSize
+	if cb.resultCount < circuitWindowSize {
+		cb.resultCount++
+	}
+
+	failures := 0
+	for i := 0; i < cb.resultCount; i++ {
+		if cb.results[i] {
+			failures++
+		}
+	}
+	shouldOpen := cb.resultCount >= circuitWindowSize && float64(failures)/float64(cb.resultCount) > circuitErrorThreshold
+	cb.mu.Unlock()
+
+	if shouldOpen {
+		cb.transitionToOpen()
+	}
+}
+
+// recordHalfOpenResult reopens the circuit (with escalating backoff) on the
+// first probe failure, or closes it once circuitHalfOpenToClose probes have
+// succeeded in a row.
+func (cb *CircuitBreaker) recordHalfOpenResult(failed bool) {
+	if failed {
+		cb.transitionToOpen()
+		return
+	}
+
+	cb.mu.Lock()
+	cb.halfOpenSuccess++
+	closed := cb.halfOpenSuccess >= circuitHalfOpenToClose
+	cb.mu.Unlock()
+
+	if closed {
+		cb.transitionToClosed()
+	}
+}
+
+func (cb *CircuitBreaker) transitionToOpen() {
+	cb.mu.Lock()
+	cb.consecutiveOpens++
+	backoff := circuitOpenBaseDuration << uint(cb.consecutiveOpens-1)
+	if backoff > circuitOpenMaxDuration || backoff <= 0 {
+		backoff = circuitOpenMaxDuration
+	}
+	cb.openUntil = time.Now().Add(backoff)
+	cb.resultCount = 0
+	cb.nextResultIdx = 0
+	cb.halfOpenSuccess = 0
+	cb.mu.Unlock()
+
+	cb.setState(CircuitOpen)
+}
+
+// transitionToHalfOpen is guarded by a CAS on cb.state so that when several
+// callers observe an expired Open circuit at once, only one of them arms the
+// half-open semaphore and resets halfOpenSuccess; the rest fall through to
+// admitHalfOpen and draw from the semaphore the winner already armed instead
+// of re-arming it back to circuitHalfOpenProbes, which would admit far more
+// than K concurrent probes.
+func (cb *CircuitBreaker) transitionToHalfOpen() {
+	if !atomic.CompareAndSwapInt32(&cb.state, int32(CircuitOpen), int32(CircuitHalfOpen)) {
+		return
+	}
+
+	cb.mu.Lock()
+	cb.halfOpenSuccess = 0
+	cb.mu.Unlock()
+	atomic.StoreInt32(&cb.halfOpenPermits, circuitHalfOpenProbes)
+	cb.publishState(CircuitHalfOpen)
+}
+
+func (cb *CircuitBreaker) transitionToClosed() {
+	cb.mu.Lock()
+	cb.consecutiveOpens = 0
+	cb.resultCount = 0
+	cb.nextResultIdx = 0
+	cb.mu.Unlock()
+	cb.setState(CircuitClosed)
+}
+
+// setState publishes the new state and its Prometheus gauges/counters.
+// Callers where multiple goroutines might race the same transition (see
+// transitionToHalfOpen) should CAS cb.state themselves and call publishState
+// directly instead, so only the winner publishes.
+func (cb *CircuitBreaker) setState(s CircuitState) {
+	atomic.StoreInt32(&cb.state, int32(s))
+	cb.publishState(s)
+}
+
+// publishState records the Prometheus counters/gauges for a transition into
+// s. Does not touch cb.state itself.
+func (cb *CircuitBreaker) publishState(s CircuitState) {
+	circuitTransitionsTotal.WithLabelValues(cb.providerID, s.String()).Inc()
+	for _, st := range []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+		v := 0.0
+		if st == s {
+			v = 1.0
+		}
+		circuitState.WithLabelValues(cb.providerID, st.String()).Set(v)
+	}
+}
+
+// State returns the breaker's current state.
+func (cb *CircuitBreaker) State() CircuitState {
+	return CircuitState(atomic.LoadInt32(&cb.state))
+}
+
+// OpenUntil returns when an Open breaker is next eligible to probe.
+func (cb *CircuitBreaker) OpenUntil() time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.openUntil
+}
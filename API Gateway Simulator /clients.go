@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,7 +13,7 @@ import (
 type ClientSimulator struct {
 	gateway *Gateway
 	clients int
-	running bool
+	running atomic.Bool
 	wg      sync.WaitGroup
 }
 
@@ -26,7 +27,7 @@ func NewClientSimulator(gw *Gateway) *ClientSimulator {
 
 // Start begins the client simulation
 func (cs *ClientSimulator) Start() {
-	cs.running = true
+	cs.running.Store(true)
 
 	for i := 0; i < cs.clients; i++ {
 		cs.wg.Add(1)
@@ -38,7 +39,7 @@ func (cs *ClientSimulator) Start() {
 
 // Stop stops the simulation
 func (cs *ClientSimulator) Stop() {
-	cs.running = false
+	cs.running.Store(false)
 }
 
 // simulateClient simulates a single client making requests
@@ -47,7 +48,7 @@ func (cs *ClientSimulator) simulateClient(clientID int) {
 
 	client := &http.Client{Timeout: 10 * time.Second}
 
-	for cs.running {
+	for cs.running.Load() {
 		// Make request
 		reqBody := `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"Hello"}]}`
 		resp, err := client.Post("http://localhost:8080/chat/completions", "application/json", bytes.NewBufferString(reqBody))
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,43 +15,141 @@ import (
 
 // Provider represents a mock upstream provider
 type Provider struct {
-	ID       string
-	Weight   int64 // Use atomic for thread-safety
-	Latency  time.Duration
+	ID        string
+	Weight    atomic.Int64 // use newProvider to construct; zero value is not a valid weight
+	Latency   time.Duration
 	ErrorRate float64 // Probability of 5xx/429
 }
 
+// newProvider constructs a Provider with its weight set. Weight is an
+// atomic.Int64, which cannot be assigned via a struct literal field.
+func newProvider(id string, weight int64, latency time.Duration, errorRate float64) *Provider {
+	p := &Provider{ID: id, Latency: latency, ErrorRate: errorRate}
+	p.Weight.Store(weight)
+	return p
+}
+
 // ProviderHealth tracks provider state
 type ProviderHealth struct {
-	mu             sync.RWMutex
-	ErrorCount     int
-	LastFailure    time.Time
-	CooldownUntil  time.Time
-	DisabledUntil  time.Time
+	mu            sync.RWMutex
+	ErrorCount    atomic.Int64
+	LastFailure   time.Time
+	DisabledUntil time.Time // billing/admin disable, independent of the circuit breaker
+
+	// EWMA load-balancing stats, updated after every non-streaming call in
+	// HandleRequest; streamed calls (handleStreamRequest) do not update them.
+	requestCount  int64
+	ewmaLatencyMs float64
+	ewmaErrorRate float64
+
+	// Rolling latency window backing p95Latency, used to decide when a
+	// request is slow enough to hedge; see hedging.go.
+	latencies    [hedgeLatencyWindow]time.Duration
+	latencyIdx   int
+	latencyCount int
+
+	// breaker gates transient-error recovery; see CircuitBreaker.
+	breaker *CircuitBreaker
+}
+
+const (
+	// ewmaAlpha is the decay factor for the latency/error-rate EWMAs: higher
+	// weights recent calls more heavily.
+	ewmaAlpha = 0.3
+	// ewmaWarmupRequests is how many calls a provider must serve before its
+	// EWMA score is trusted; until then SelectProvider falls back to
+	// weighted random so a single slow/fast sample can't dominate.
+	ewmaWarmupRequests = 20
+	// ewmaErrorPenalty scales how much the error-rate EWMA inflates a
+	// provider's latency score.
+	ewmaErrorPenalty = 5.0
+)
+
+// recordResult folds a completed call's latency and outcome into the
+// provider's EWMA stats and refreshes its Prometheus score gauge.
+func (h *ProviderHealth) recordResult(providerID string, latency time.Duration, failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	errSample := 0.0
+	if failed {
+		errSample = 1.0
+	}
+	latencyMs := float64(latency.Milliseconds())
+
+	if h.requestCount == 0 {
+		h.ewmaLatencyMs = latencyMs
+		h.ewmaErrorRate = errSample
+	} else {
+		h.ewmaLatencyMs = ewmaAlpha*latencyMs + (1-ewmaAlpha)*h.ewmaLatencyMs
+		h.ewmaErrorRate = ewmaAlpha*errSample + (1-ewmaAlpha)*h.ewmaErrorRate
+	}
+	h.requestCount++
+
+	providerScore.WithLabelValues(providerID).Set(h.score())
+}
+
+// score computes the composite latency/error score used by power-of-two-
+// choices selection; lower is better. Caller must hold h.mu.
+func (h *ProviderHealth) score() float64 {
+	return h.ewmaLatencyMs * (1 + h.ewmaErrorRate*ewmaErrorPenalty)
+}
+
+// warm reports whether the provider has served enough requests for its EWMA
+// score to be trusted over weighted-random selection.
+func (h *ProviderHealth) warm() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.requestCount >= ewmaWarmupRequests
 }
 
 // Gateway handles routing, rate limiting, and failover
 type Gateway struct {
 	providers      []*Provider
 	health         map[string]*ProviderHealth
-	limiter        *RateLimiter
+	limiter        Limiter // global fallback limit, ahead of the per-key/per-route policies
 	totalWeight    int64
 	mu             sync.RWMutex
+
+	// Limiters holds the per-key rate limiters this node owns, keyed by
+	// "<identity>:<resource>" (e.g. "api-key-123:/chat/completions"). Keys
+	// not owned by this node are forwarded to their owner via peers. Each
+	// limiter's algorithm is chosen by the RateLimitPolicy for its route.
+	Limiters   map[string]Limiter
+	limitersMu sync.RWMutex
+	policies   map[string]RateLimitPolicy
+
+	selfAddr  string
+	discovery PeerDiscovery
+	ring      *hashRing
+	peers     *PeerClient
+	broadcast bool
+
+	// Hedging: routes in hedgeRoutes may fire a second request to a
+	// different provider if the primary is slower than its p95; hedgeBudget
+	// bounds how much extra load that can add. See hedging.go.
+	hedgeRoutes map[string]bool
+	hedgeBudget Limiter
 }
 
 // NewGateway creates a new gateway with 3 providers
 func NewGateway() *Gateway {
 	providers := []*Provider{
-		{ID: "provider1", Weight: 70, Latency: 100 * time.Millisecond, ErrorRate: 0.05},
-		{ID: "provider2", Weight: 20, Latency: 500 * time.Millisecond, ErrorRate: 0.10},
-		{ID: "provider3", Weight: 10, Latency: 2 * time.Second, ErrorRate: 0.20},
+		newProvider("provider1", 70, 100*time.Millisecond, 0.05),
+		newProvider("provider2", 20, 500*time.Millisecond, 0.10),
+		newProvider("provider3", 10, 2*time.Second, 0.20),
 	}
 
 	health := make(map[string]*ProviderHealth)
 	totalWeight := int64(0)
 	for _, p := range providers {
-		health[p.ID] = &ProviderHealth{}
-		totalWeight += p.Weight
+		health[p.ID] = &ProviderHealth{breaker: NewCircuitBreaker(p.ID)}
+		totalWeight += p.Weight.Load()
+	}
+
+	policies := make(map[string]RateLimitPolicy)
+	for _, p := range defaultPolicies() {
+		policies[p.Route] = p
 	}
 
 	return &Gateway{
@@ -58,91 +157,313 @@ func NewGateway() *Gateway {
 		health:      health,
 		limiter:     NewRateLimiter(1000), // 1000 RPS global limit
 		totalWeight: totalWeight,
+		Limiters:    make(map[string]Limiter),
+		policies:    policies,
+		selfAddr:    "self",
+		discovery:   NewStaticPeerDiscovery([]string{"self"}),
+		ring:        newHashRing(100),
+		peers:       NewPeerClient(10*time.Millisecond, 50),
+		hedgeRoutes: map[string]bool{"/chat/completions": true},
+		hedgeBudget: NewRateLimiter(1000 * hedgeBudgetFraction),
 	}
 }
 
-// SelectProvider selects a provider using weighted random selection
-func (g *Gateway) SelectProvider() *Provider {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+// WithPeers configures distributed per-key rate limiting: selfAddr, this
+// node's address on the hash ring; discovery, the set of gateway instances
+// that jointly own the keyspace; and broadcast, whether an owner calls
+// PeerClient.Broadcast with the key's remaining-token snapshot after each
+// local decision. Received snapshots are not consulted: a non-owning node
+// still forwards every check to the key's owner.
+func (g *Gateway) WithPeers(selfAddr string, discovery PeerDiscovery, broadcast bool) {
+	g.selfAddr = selfAddr
+	g.discovery = discovery
+	g.broadcast = broadcast
+	g.ring.Set(discovery.Peers())
+}
 
-	// Filter available providers (not in cooldown)
-	available := make([]*Provider, 0)
-	for _, p := range g.providers {
-		if !g.isInCooldown(p.ID) {
-			available = append(available, p)
-		}
+// rateLimitKey builds the per-key limiter identity from the request's
+// identity (API key or client IP) and the resource being accessed.
+func rateLimitKey(identity, resource string) string {
+	return identity + ":" + resource
+}
+
+// policyFor returns the RateLimitPolicy configured for a route, falling
+// back to a default token-bucket policy if the route has no specific entry.
+func (g *Gateway) policyFor(resource string) RateLimitPolicy {
+	if p, ok := g.policies[resource]; ok {
+		return p
 	}
+	return RateLimitPolicy{Route: resource, Algorithm: AlgorithmTokenBucket, Rate: 1000, Burst: 100}
+}
 
-	if len(available) == 0 {
-		// All in cooldown, pick the one expiring soonest
-		return g.selectSoonestExpiring()
+// limiterFor returns the owning limiter for key, building one from the
+// route's RateLimitPolicy on first use. If another peer owns the key, owned
+// is false and callers should consult peers instead.
+func (g *Gateway) limiterFor(key, resource string) (rl Limiter, owned bool) {
+	owner, found := g.ring.Owner(key)
+	if found && owner != g.selfAddr {
+		return nil, false
 	}
 
-	// Weighted random selection
-	r := rand.Int63n(g.totalWeight)
-	currentSum := int64(0)
-	for _, p := range available {
-		currentSum += atomic.LoadInt64(&p.Weight)
-		if r < currentSum {
-			return p
+	g.limitersMu.RLock()
+	rl, exists := g.Limiters[key]
+	g.limitersMu.RUnlock()
+	if exists {
+		return rl, true
+	}
+
+	g.limitersMu.Lock()
+	defer g.limitersMu.Unlock()
+	if rl, exists = g.Limiters[key]; exists {
+		return rl, true
+	}
+	rl = buildLimiter(g.policyFor(resource))
+	g.Limiters[key] = rl
+	return rl, true
+}
+
+// allowKeyed is the distributed entry point for per-key, per-route rate
+// limiting. If this node owns the key it decides locally (and, in broadcast
+// mode, schedules a snapshot push to peers); otherwise it forwards the
+// check to the owning peer via PeerClient.
+func (g *Gateway) allowKeyed(identity, resource string) Decision {
+	key := rateLimitKey(identity, resource)
+
+	if rl, owned := g.limiterFor(key, resource); owned {
+		decision, _ := rl.Allow(key, 1)
+		if g.broadcast {
+			go g.peers.Broadcast(g.discovery.Peers(), RateLimitSnapshot{
+				Key:       key,
+				Remaining: decision.Remaining,
+				ResetAt:   decision.ResetAt,
+			})
 		}
+		return decision
 	}
 
-	return available[0]
+	owner, _ := g.ring.Owner(key)
+	snapshot := g.peers.GetRateLimit(owner, KeyRequest{Key: key, Cost: 1})
+	return Decision{Allowed: snapshot.Remaining > 0, Remaining: snapshot.Remaining, ResetAt: snapshot.ResetAt}
 }
 
-// isInCooldown checks if a provider is in cooldown
-func (g *Gateway) isInCooldown(providerID string) bool {
-	h := g.health[providerID]
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	now := time.Now()
-	return now.Before(h.CooldownUntil) || now.Before(h.DisabledUntil)
+// SelectProvider selects an available provider. Providers whose circuit is
+// Open are skipped; at most circuitHalfOpenProbes concurrent
+// requests are admitted to a HalfOpen provider, tracked via an atomic
+// semaphore on its CircuitBreaker. The one exception is when no provider is
+// admitted at all: selectSoonestRecovering may then return a provider whose
+// breaker denied it, outside that probe limit. Among admitted providers, the
+// choice is weighted random while any of them is still warming up (has
+// served fewer than ewmaWarmupRequests calls), and power-of-two choices over
+// their EWMA latency/error score once all have warmed up. Exactly one of done/release must be called
+// when the call to the returned provider is settled: done releases the
+// half-open probe permit and feeds the outcome into the breaker; release
+// only returns the permit, for callers (hedging) whose call was cancelled
+// before its outcome was known and must not score a guess into the breaker.
+func (g *Gateway) SelectProvider() (provider *Provider, done func(failed bool), release func()) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	candidates := g.admittedCandidates()
+	if len(candidates) == 0 {
+		// Nothing admitted right now: try providers in order of soonest
+		// recovery through their breaker's Allow(); if every breaker denies,
+		// the soonest-recovering provider is returned anyway, outside the
+		// circuitHalfOpenProbes limit.
+		return g.selectSoonestRecovering()
+	}
+
+	chosen := g.chooseAmong(candidates)
+	for _, c := range candidates {
+		if c.provider != chosen.provider {
+			c.release()
+		}
+	}
+
+	return chosen.provider,
+		func(failed bool) {
+			chosen.release()
+			g.health[chosen.provider.ID].breaker.RecordResult(failed)
+		},
+		chosen.release
 }
 
-// selectSoonestExpiring selects the provider with soonest cooldown expiry
-func (g *Gateway) selectSoonestExpiring() *Provider {
-	var selected *Provider
-	soonest := time.Now().Add(24 * time.Hour) // Far future
+// providerCandidate is a provider that was admitted by its circuit breaker
+// for this selection round; release returns any half-open probe permit it
+// holds if it ends up not being chosen.
+type providerCandidate struct {
+	provider *Provider
+	release  func()
+}
 
+// admittedCandidates returns the providers not billing-disabled and
+// currently admitted by their circuit breaker (Closed, or Open-but-expired
+// and admitted as a HalfOpen probe).
+func (g *Gateway) admittedCandidates() []providerCandidate {
+	candidates := make([]providerCandidate, 0, len(g.providers))
 	for _, p := range g.providers {
 		h := g.health[p.ID]
+
 		h.mu.RLock()
-		expiry := h.CooldownUntil
-		if h.DisabledUntil.After(h.CooldownUntil) {
-			expiry = h.DisabledUntil
-		}
+		billingDisabled := time.Now().Before(h.DisabledUntil)
 		h.mu.RUnlock()
+		if billingDisabled {
+			continue
+		}
+
+		admit, release := h.breaker.Allow()
+		if !admit {
+			continue
+		}
+		candidates = append(candidates, providerCandidate{provider: p, release: release})
+	}
+	return candidates
+}
+
+// chooseAmong applies power-of-two-choices EWMA scoring over admitted
+// candidates, falling back to weighted random while providers are warming
+// up.
+func (g *Gateway) chooseAmong(candidates []providerCandidate) providerCandidate {
+	available := make([]*Provider, len(candidates))
+	for i, c := range candidates {
+		available[i] = c.provider
+	}
 
-		if expiry.Before(soonest) {
-			soonest = expiry
-			selected = p
+	if p := g.selectByScore(available); p != nil {
+		for _, c := range candidates {
+			if c.provider == p {
+				return c
+			}
 		}
 	}
 
-	return selected
+	weight := int64(0)
+	for _, c := range candidates {
+		weight += c.provider.Weight.Load()
+	}
+	if weight <= 0 {
+		return candidates[0]
+	}
+
+	r := rand.Int63n(weight)
+	currentSum := int64(0)
+	for _, c := range candidates {
+		currentSum += c.provider.Weight.Load()
+		if r < currentSum {
+			return c
+		}
+	}
+	return candidates[len(candidates)-1]
 }
 
-// MarkFailure marks a provider as failed and applies cooldown
+// selectByScore implements power-of-two choices: it samples two available
+// providers at random and returns the one with the lower (better) EWMA
+// score. Returns nil while any available provider is still warming up, or
+// if fewer than two are available, signaling the caller to fall back to
+// weighted random.
+func (g *Gateway) selectByScore(available []*Provider) *Provider {
+	warm := make([]*Provider, 0, len(available))
+	for _, p := range available {
+		if !g.health[p.ID].warm() {
+			return nil
+		}
+		warm = append(warm, p)
+	}
+
+	if len(warm) < 2 {
+		return nil
+	}
+
+	a := warm[rand.Intn(len(warm))]
+	b := warm[rand.Intn(len(warm))]
+
+	ha, hb := g.health[a.ID], g.health[b.ID]
+	ha.mu.RLock()
+	scoreA := ha.score()
+	ha.mu.RUnlock()
+	hb.mu.RLock()
+	scoreB := hb.score()
+	hb.mu.RUnlock()
+
+	if scoreA <= scoreB {
+		return a
+	}
+	return b
+}
+
+// selectSoonestRecovering is used only when every provider was rejected by
+// admittedCandidates (all billing-disabled or circuit-denied). It tries
+// providers in order of soonest expected recovery and returns the first one
+// whose breaker actually admits it. If every breaker currently denies (e.g.
+// all half-open permits are in use), it still returns the soonest-recovering
+// provider so the caller has someone to call, without taking a probe permit:
+// that call is not counted against the half-open probe limit and can exceed
+// it. RecordResult still reports the outcome to its breaker like any other call.
+func (g *Gateway) selectSoonestRecovering() (*Provider, func(failed bool), func()) {
+	ordered := g.providersByRecovery()
+
+	for _, p := range ordered {
+		h := g.health[p.ID]
+		if admit, release := h.breaker.Allow(); admit {
+			return p, func(failed bool) {
+				release()
+				h.breaker.RecordResult(failed)
+			}, release
+		}
+	}
+
+	p := ordered[0]
+	return p, func(failed bool) { g.health[p.ID].breaker.RecordResult(failed) }, func() {}
+}
+
+// providersByRecovery orders providers by how soon they're expected to
+// become eligible for admission (whichever is later of billing
+// DisabledUntil and the circuit breaker's OpenUntil).
+func (g *Gateway) providersByRecovery() []*Provider {
+	ordered := append([]*Provider(nil), g.providers...)
+	sort.Slice(ordered, func(i, j int) bool {
+		return g.recoveryTime(ordered[i]).Before(g.recoveryTime(ordered[j]))
+	})
+	return ordered
+}
+
+// recoveryTime is when a provider is next eligible for admission.
+func (g *Gateway) recoveryTime(p *Provider) time.Time {
+	h := g.health[p.ID]
+	h.mu.RLock()
+	expiry := h.DisabledUntil
+	h.mu.RUnlock()
+	if openUntil := h.breaker.OpenUntil(); openUntil.After(expiry) {
+		expiry = openUntil
+	}
+	return expiry
+}
+
+// MarkFailure marks a provider as failed. Billing errors disable the
+// provider outright (an admin/account-level block, not a transient fault);
+// all other errors only bump ErrorCount and LastFailure here. The circuit
+// breaker learns of a call's outcome through the done callback that
+// SelectProvider returned, not through MarkFailure.
 func (g *Gateway) MarkFailure(providerID string, errorType string) {
 	h := g.health[providerID]
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.ErrorCount++
-	h.LastFailure = time.Now()
 
-	cooldown := g.calculateCooldown(h.ErrorCount, errorType)
 	if errorType == "billing" {
+		errorCount := h.ErrorCount.Add(1)
+		h.mu.Lock()
+		h.LastFailure = time.Now()
+		cooldown := g.calculateCooldown(errorCount, errorType)
 		h.DisabledUntil = time.Now().Add(cooldown)
-	} else {
-		h.CooldownUntil = time.Now().Add(cooldown)
+		h.mu.Unlock()
+		return
 	}
+
+	h.ErrorCount.Add(1)
+	h.mu.Lock()
+	h.LastFailure = time.Now()
+	h.mu.Unlock()
 }
 
 // calculateCooldown computes exponential backoff with jitter
-func (g *Gateway) calculateCooldown(errorCount int, errorType string) time.Duration {
+func (g *Gateway) calculateCooldown(errorCount int64, errorType string) time.Duration {
 	base := 1 * time.Minute
 	if errorCount <= 0 {
 		return 0
@@ -165,42 +486,77 @@ func (g *Gateway) calculateCooldown(errorCount int, errorType string) time.Durat
 
 // HandleRequest handles incoming requests
 func (g *Gateway) HandleRequest(c *gin.Context) {
-	// Rate limiting
-	if !g.limiter.Allow() {
+	// Global rate limiting
+	if decision, _ := g.limiter.Allow("global", 1); !decision.Allowed {
+		rateLimitHits.Inc()
+		writeRateLimitHeaders(c, decision)
+		c.JSON(429, gin.H{"error": "Rate limit exceeded"})
+		return
+	}
+
+	// Per-key, per-route rate limiting (per API key / client IP, per resource)
+	identity := c.GetHeader("X-API-Key")
+	if identity == "" {
+		identity = c.ClientIP()
+	}
+	decision := g.allowKeyed(identity, c.FullPath())
+	writeRateLimitHeaders(c, decision)
+	if !decision.Allowed {
 		rateLimitHits.Inc()
 		c.JSON(429, gin.H{"error": "Rate limit exceeded"})
 		return
 	}
 
-	// Select provider
-	provider := g.SelectProvider()
+	var req chatCompletionRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Stream {
+		g.handleStreamRequest(c)
+		return
+	}
 
-	// Simulate request to provider
-	start := time.Now()
-	err := g.simulateProviderCall(provider)
-	duration := time.Since(start)
+	// Select provider (optionally hedged against a second provider)
+	provider, done, release := g.SelectProvider()
+
+	actual, duration, err := g.callWithHedge(c.Request.Context(), c.FullPath(), provider, done, release)
+	g.health[actual.ID].recordResult(actual.ID, duration, err != nil)
+	g.health[actual.ID].recordLatency(duration)
 
 	if err != nil {
-		g.MarkFailure(provider.ID, "rate_limit") // Assume 429 for simplicity
-		providerErrors.WithLabelValues(provider.ID, "rate_limit").Inc()
-		requestsTotal.WithLabelValues(provider.ID, "error").Inc()
+		g.MarkFailure(actual.ID, "rate_limit") // Assume 429 for simplicity
+		providerErrors.WithLabelValues(actual.ID, "rate_limit").Inc()
+		requestsTotal.WithLabelValues(actual.ID, "error").Inc()
 		c.JSON(502, gin.H{"error": "Upstream error"})
 		return
 	}
 
-	requestDuration.WithLabelValues(provider.ID).Observe(duration.Seconds())
-	requestsTotal.WithLabelValues(provider.ID, "success").Inc()
+	requestDuration.WithLabelValues(actual.ID).Observe(duration.Seconds())
+	requestsTotal.WithLabelValues(actual.ID, "success").Inc()
 
 	c.JSON(200, gin.H{
-		"provider": provider.ID,
+		"provider": actual.ID,
 		"latency":  duration.Milliseconds(),
 	})
 }
 
-// simulateProviderCall simulates calling a provider
-func (g *Gateway) simulateProviderCall(p *Provider) error {
-	// Simulate latency
-	time.Sleep(p.Latency)
+// writeRateLimitHeaders surfaces a rate-limit Decision as the standard
+// X-RateLimit-* headers, plus Retry-After when the request was rejected.
+func writeRateLimitHeaders(c *gin.Context, d Decision) {
+	c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", d.Remaining))
+	c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", d.ResetAt.Unix()))
+	if !d.Allowed {
+		c.Header("Retry-After", fmt.Sprintf("%.0f", d.RetryAfter.Seconds()))
+	}
+}
+
+// simulateProviderCall simulates calling a provider. ctx cancellation (used
+// by hedged requests to abandon the losing racer) stops the simulated
+// latency immediately instead of waiting it out.
+func (g *Gateway) simulateProviderCall(ctx context.Context, p *Provider) error {
+	select {
+	case <-time.After(p.Latency):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	// Simulate errors
 	if rand.Float64() < p.ErrorRate {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	hedgeLatencyWindow    = 20                     // samples kept for the rolling p95 estimate
+	hedgeDefaultThreshold = 200 * time.Millisecond  // used until a provider has a full window
+	hedgeBudgetFraction   = 0.05                    // at most 5% of global RPS may be hedged
+)
+
+// recordLatency folds a completed call's latency into the provider's
+// rolling window backing p95Latency.
+func (h *ProviderHealth) recordLatency(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latencies[h.latencyIdx] = latency
+	h.latencyIdx = (h.latencyIdx + 1) % hedgeLatencyWindow
+	if h.latencyCount < hedgeLatencyWindow {
+		h.latencyCount++
+	}
+}
+
+// p95Latency estimates the provider's 95th-percentile latency from its
+// rolling window, falling back to hedgeDefaultThreshold until the window
+// has filled.
+func (h *ProviderHealth) p95Latency() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.latencyCount < hedgeLatencyWindow {
+		return hedgeDefaultThreshold
+	}
+
+	sorted := append([]time.Duration(nil), h.latencies[:]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Nearest-rank: the ceil(0.95*n)-th smallest sample, zero-based.
+	idx := (len(sorted)*95+99)/100 - 1
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// hedgeEnabled reports whether a route is configured to hedge slow requests.
+func (g *Gateway) hedgeEnabled(resource string) bool {
+	return g.hedgeRoutes[resource]
+}
+
+// callWithHedge calls primary and, if the route is hedge-enabled, races it
+// against a second provider once primary runs past its own p95 latency.
+// Whichever finishes first wins; the loser is cancelled via context and
+// released (permit returned) without ever being scored into its breaker,
+// since its outcome when cancelled mid-flight is unknown. The hedge budget
+// (a token bucket capped at hedgeBudgetFraction of the global RPS) bounds
+// how much extra load hedging can add. primaryDone/primaryRelease are the
+// record and release-only closures SelectProvider returned for primary;
+// callWithHedge invokes exactly one of them exactly once. The returned
+// duration is only the winning call's own latency, not the time spent
+// waiting to decide whether to hedge.
+func (g *Gateway) callWithHedge(ctx context.Context, resource string, primary *Provider, primaryDone func(failed bool), primaryRelease func()) (*Provider, time.Duration, error) {
+	if !g.hedgeEnabled(resource) {
+		start := time.Now()
+		err := g.simulateProviderCall(ctx, primary)
+		primaryDone(err != nil)
+		return primary, time.Since(start), err
+	}
+
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	primaryStart := time.Now()
+	primaryResult := make(chan error, 1)
+	go func() { primaryResult <- g.simulateProviderCall(primaryCtx, primary) }()
+
+	select {
+	case err := <-primaryResult:
+		primaryDone(err != nil)
+		return primary, time.Since(primaryStart), err
+	case <-time.After(g.health[primary.ID].p95Latency()):
+		// Primary is running slower than its own p95; consider hedging.
+	}
+
+	if decision, _ := g.hedgeBudget.Allow(resource, 1); !decision.Allowed {
+		err := <-primaryResult
+		primaryDone(err != nil)
+		return primary, time.Since(primaryStart), err
+	}
+
+	hedgeProvider, hedgeDone, hedgeRelease := g.pickHedgeProvider(primary)
+	if hedgeProvider == nil {
+		err := <-primaryResult
+		primaryDone(err != nil)
+		return primary, time.Since(primaryStart), err
+	}
+
+	hedgedRequestsTotal.Inc()
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	hedgeStart := time.Now()
+	hedgeResult := make(chan error, 1)
+	go func() { hedgeResult <- g.simulateProviderCall(hedgeCtx, hedgeProvider) }()
+
+	select {
+	case err := <-primaryResult:
+		primaryDone(err != nil)
+		// The hedge racer was cancelled mid-flight; its outcome is unknown,
+		// so only its half-open permit is released - it's never scored into
+		// the breaker as a success or failure.
+		go func() { <-hedgeResult; hedgeRelease() }()
+		return primary, time.Since(primaryStart), err
+	case err := <-hedgeResult:
+		hedgeWinsTotal.WithLabelValues(hedgeProvider.ID).Inc()
+		hedgeDone(err != nil)
+		// Same reasoning for the cancelled primary: release its permit, but
+		// don't feed a made-up outcome into its breaker.
+		go func() { <-primaryResult; primaryRelease() }()
+		return hedgeProvider, time.Since(hedgeStart), err
+	}
+}
+
+// pickHedgeProvider selects a provider other than primary to race against
+// it, using the same admission and scoring rules as SelectProvider. done
+// releases the permit and records the outcome; release only returns the
+// permit, for the case where the hedge racer is cancelled before its
+// outcome is known. Returns (nil, nil, nil) if no other provider is
+// currently admitted.
+func (g *Gateway) pickHedgeProvider(primary *Provider) (provider *Provider, done func(failed bool), release func()) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	candidates := g.admittedCandidates()
+	others := candidates[:0]
+	for _, c := range candidates {
+		if c.provider.ID == primary.ID {
+			c.release()
+			continue
+		}
+		others = append(others, c)
+	}
+	if len(others) == 0 {
+		return nil, nil, nil
+	}
+
+	chosen := g.chooseAmong(others)
+	for _, c := range others {
+		if c.provider != chosen.provider {
+			c.release()
+		}
+	}
+	return chosen.provider,
+		func(failed bool) {
+			chosen.release()
+			g.health[chosen.provider.ID].breaker.RecordResult(failed)
+		},
+		chosen.release
+}
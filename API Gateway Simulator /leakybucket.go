@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// LeakyBucketLimiter implements the leaky bucket algorithm: each key holds a
+// queue level that drains at a constant rate, and requests are admitted as
+// long as they don't overflow the bucket. Unlike token bucket it smooths
+// bursts rather than allowing them.
+type LeakyBucketLimiter struct {
+	rate     float64 // drain rate, units per second
+	capacity float64 // bucket size, units
+
+	mu      sync.Mutex
+	buckets map[string]*leakyBucketState
+}
+
+type leakyBucketState struct {
+	level     float64
+	lastDrain time.Time
+}
+
+// NewLeakyBucketLimiter creates a leaky bucket limiter draining at rate
+// units/second with the given bucket capacity.
+func NewLeakyBucketLimiter(rate, capacity float64) *LeakyBucketLimiter {
+	return &LeakyBucketLimiter{
+		rate:     rate,
+		capacity: capacity,
+		buckets:  make(map[string]*leakyBucketState),
+	}
+}
+
+// Allow implements Limiter.
+func (lb *LeakyBucketLimiter) Allow(key string, cost int64) (Decision, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	state, ok := lb.buckets[key]
+	now := time.Now()
+	if !ok {
+		state = &leakyBucketState{lastDrain: now}
+		lb.buckets[key] = state
+	}
+
+	elapsed := now.Sub(state.lastDrain).Seconds()
+	state.level = maxFloat(0, state.level-elapsed*lb.rate)
+	state.lastDrain = now
+
+	need := float64(cost)
+	drainETA := time.Duration(state.level / lb.rate * float64(time.Second))
+
+	if state.level+need <= lb.capacity {
+		state.level += need
+		return Decision{
+			Allowed:   true,
+			Remaining: int64(lb.capacity - state.level),
+			ResetAt:   now.Add(drainETA),
+		}, nil
+	}
+
+	overflow := state.level + need - lb.capacity
+	return Decision{
+		Allowed:    false,
+		Remaining:  int64(lb.capacity - state.level),
+		ResetAt:    now.Add(drainETA),
+		RetryAfter: time.Duration(overflow / lb.rate * float64(time.Second)),
+	}, nil
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// drainDeadline bounds how long graceful shutdown waits for in-flight
+// requests to finish before forcing the listener closed.
+const drainDeadline = 30 * time.Second
+
 // Simulator is the main struct for the high-concurrency simulator
 type Simulator struct {
-	gateway *Gateway
-	clients *ClientSimulator
+	gateway   *Gateway
+	clients   *ClientSimulator
+	admission *AdmissionController
 }
 
 // NewSimulator creates a new simulator instance
@@ -23,12 +30,15 @@ func NewSimulator() *Simulator {
 	clients := NewClientSimulator(gw)
 
 	return &Simulator{
-		gateway: gw,
-		clients: clients,
+		gateway:   gw,
+		clients:   clients,
+		admission: NewAdmissionController(),
 	}
 }
 
-// Start starts the simulator
+// Start starts the simulator and blocks until a SIGINT/SIGTERM triggers a
+// graceful shutdown: the client simulation and gateway listener stop
+// accepting new work while in-flight requests are allowed to drain.
 func (s *Simulator) Start() {
 	// Start metrics server
 	go s.startMetricsServer()
@@ -37,7 +47,22 @@ func (s *Simulator) Start() {
 	go s.clients.Start()
 
 	// Start gateway server
-	s.startGatewayServer()
+	srv := s.startGatewayServer()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	log.Println("Shutdown signal received, draining...")
+	shutdownBy := time.Now().Add(drainDeadline)
+	s.clients.Stop()
+	s.admission.Drain(drainDeadline)
+
+	ctx, cancel := context.WithDeadline(context.Background(), shutdownBy)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Gateway server shutdown error: %v", err)
+	}
 }
 
 // startMetricsServer starts the Prometheus metrics endpoint
@@ -47,15 +72,23 @@ func (s *Simulator) startMetricsServer() {
 	log.Fatal(http.ListenAndServe(":9090", nil))
 }
 
-// startGatewayServer starts the gateway API server
-func (s *Simulator) startGatewayServer() {
+// startGatewayServer starts the gateway API server and returns the
+// underlying http.Server so the caller can shut it down gracefully.
+func (s *Simulator) startGatewayServer() *http.Server {
 	r := gin.Default()
+	r.Use(s.admission.Middleware())
 
 	// Gateway endpoints
 	r.POST("/chat/completions", s.gateway.HandleRequest)
 
-	log.Println("Gateway server starting on :8080")
-	r.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		log.Println("Gateway server starting on :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Gateway server error: %v", err)
+		}
+	}()
+	return srv
 }
 
 func main() {
@@ -44,4 +44,74 @@ var (
 			Help: "Number of active goroutines",
 		},
 	)
+
+	providerScore = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "simulator_provider_score",
+			Help: "Composite EWMA latency/error score used for load balancing (lower is better)",
+		},
+		[]string{"provider"},
+	)
+
+	circuitState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "simulator_circuit_state",
+			Help: "1 for a provider's current circuit-breaker state, 0 otherwise",
+		},
+		[]string{"provider", "state"},
+	)
+
+	circuitTransitionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "simulator_circuit_transitions_total",
+			Help: "Total circuit-breaker state transitions, labeled by the state entered",
+		},
+		[]string{"provider", "state"},
+	)
+
+	streamTTFT = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "simulator_stream_ttft_seconds",
+			Help:    "Time to first streamed token, from request start",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	streamTokensTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "simulator_stream_tokens_total",
+			Help: "Total simulated tokens streamed to clients",
+		},
+		[]string{"provider"},
+	)
+
+	hedgedRequestsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "simulator_hedged_requests_total",
+			Help: "Total requests for which a hedge request was fired",
+		},
+	)
+
+	hedgeWinsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "simulator_hedge_wins_total",
+			Help: "Total requests served by the hedge request rather than the primary",
+		},
+		[]string{"provider"},
+	)
+
+	admissionShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "simulator_admission_shed_total",
+			Help: "Total requests shed by admission control, labeled by priority class",
+		},
+		[]string{"class"},
+	)
+
+	inflightRequests = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "simulator_inflight_requests",
+			Help: "Current number of requests admitted and in flight",
+		},
+	)
 )
\ No newline at end of file
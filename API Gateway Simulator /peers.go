@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PeerDiscovery resolves the current set of gateway peers participating in
+// distributed rate limiting. StaticPeerDiscovery covers the common case of a
+// fixed peer list; DiscoveryHook lets an external membership system (e.g. a
+// memberlist gossip pool) plug in without this package depending on it.
+type PeerDiscovery interface {
+	Peers() []string
+}
+
+// StaticPeerDiscovery returns a fixed, pre-configured list of peer addresses.
+type StaticPeerDiscovery struct {
+	addrs []string
+}
+
+// NewStaticPeerDiscovery creates a PeerDiscovery backed by a fixed address list.
+func NewStaticPeerDiscovery(addrs []string) *StaticPeerDiscovery {
+	return &StaticPeerDiscovery{addrs: addrs}
+}
+
+// Peers returns the configured peer addresses.
+func (s *StaticPeerDiscovery) Peers() []string {
+	return s.addrs
+}
+
+// DiscoveryHook adapts a membership callback (e.g. a memberlist cluster's
+// Members() func) to the PeerDiscovery interface, so a real gossip-based
+// membership pool can be wired in without a hard dependency here.
+type DiscoveryHook func() []string
+
+// Peers invokes the underlying hook.
+func (h DiscoveryHook) Peers() []string {
+	return h()
+}
+
+// hashRing implements consistent hashing over the peer set so each
+// rate-limit key maps to exactly one owning peer, with minimal reshuffling
+// when peers join or leave.
+type hashRing struct {
+	mu           sync.RWMutex
+	vnodes       int
+	sortedHashes []uint32
+	hashToPeer   map[uint32]string
+}
+
+// newHashRing builds a ring with the given number of virtual nodes per peer.
+func newHashRing(vnodes int) *hashRing {
+	return &hashRing{
+		vnodes:     vnodes,
+		hashToPeer: make(map[uint32]string),
+	}
+}
+
+// Set replaces the ring membership with the given peer addresses.
+func (r *hashRing) Set(peers []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hashToPeer = make(map[uint32]string, len(peers)*r.vnodes)
+	r.sortedHashes = r.sortedHashes[:0]
+
+	for _, p := range peers {
+		for v := 0; v < r.vnodes; v++ {
+			h := hashKey(fmt.Sprintf("%s#%d", p, v))
+			r.hashToPeer[h] = p
+			r.sortedHashes = append(r.sortedHashes, h)
+		}
+	}
+
+	sort.Slice(r.sortedHashes, func(i, j int) bool { return r.sortedHashes[i] < r.sortedHashes[j] })
+}
+
+// Owner returns the peer responsible for a given rate-limit key.
+func (r *hashRing) Owner(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.sortedHashes) == 0 {
+		return "", false
+	}
+
+	h := hashKey(key)
+	idx := sort.Search(len(r.sortedHashes), func(i int) bool { return r.sortedHashes[i] >= h })
+	if idx == len(r.sortedHashes) {
+		idx = 0
+	}
+
+	return r.hashToPeer[r.sortedHashes[idx]], true
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// KeyRequest asks the owning peer for the rate-limit decision on a single key.
+type KeyRequest struct {
+	Key  string
+	Cost int64
+}
+
+// RateLimitSnapshot is the owning peer's view of a key's bucket. It is both
+// the reply to a forwarded KeyRequest and the payload of the periodic
+// global-broadcast push used to keep non-owning peers approximately in sync.
+type RateLimitSnapshot struct {
+	Key       string
+	Remaining int64
+	ResetAt   time.Time
+}
+
+// PeerClient forwards rate-limit checks to the peer that owns a given key,
+// batching concurrent lookups to amortize the round trip. This mirrors
+// gubernator's GetRateLimits batching: callers queue a key and a background
+// flusher drains the queue either on a timer or once it reaches maxBatch.
+type PeerClient struct {
+	flushInterval time.Duration
+	maxBatch      int
+
+	mu      sync.Mutex
+	pending map[string][]pendingCheck
+
+	limitersMu sync.Mutex
+	limiters   map[string]*RateLimiter // simulates each owning peer's bucket for a key
+}
+
+type pendingCheck struct {
+	req   KeyRequest
+	reply chan RateLimitSnapshot
+}
+
+// NewPeerClient creates a PeerClient with the given batching parameters and
+// starts its background flush loop.
+func NewPeerClient(flushInterval time.Duration, maxBatch int) *PeerClient {
+	pc := &PeerClient{
+		flushInterval: flushInterval,
+		maxBatch:      maxBatch,
+		pending:       make(map[string][]pendingCheck),
+		limiters:      make(map[string]*RateLimiter),
+	}
+	go pc.flushLoop()
+	return pc
+}
+
+// GetRateLimit queues a key check against its owning peer and blocks until
+// the batch containing it has been flushed.
+func (pc *PeerClient) GetRateLimit(peer string, req KeyRequest) RateLimitSnapshot {
+	reply := make(chan RateLimitSnapshot, 1)
+
+	pc.mu.Lock()
+	pc.pending[peer] = append(pc.pending[peer], pendingCheck{req: req, reply: reply})
+	shouldFlush := len(pc.pending[peer]) >= pc.maxBatch
+	pc.mu.Unlock()
+
+	if shouldFlush {
+		pc.flushPeer(peer)
+	}
+
+	return <-reply
+}
+
+// flushLoop periodically flushes every peer's pending batch.
+func (pc *PeerClient) flushLoop() {
+	ticker := time.NewTicker(pc.flushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pc.mu.Lock()
+		peers := make([]string, 0, len(pc.pending))
+		for peer := range pc.pending {
+			peers = append(peers, peer)
+		}
+		pc.mu.Unlock()
+
+		for _, peer := range peers {
+			pc.flushPeer(peer)
+		}
+	}
+}
+
+// flushPeer drains and sends the pending batch for a single peer over the
+// simulated RPC transport.
+func (pc *PeerClient) flushPeer(peer string) {
+	pc.mu.Lock()
+	batch := pc.pending[peer]
+	delete(pc.pending, peer)
+	pc.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	keys := make([]KeyRequest, len(batch))
+	for i, b := range batch {
+		keys[i] = b.req
+	}
+
+	snapshots := pc.callPeer(peer, keys)
+	for i, b := range batch {
+		b.reply <- snapshots[i]
+	}
+}
+
+// callPeer simulates the gRPC GetRateLimits round trip to a peer. A real
+// deployment would dial the peer's gRPC endpoint here instead; this
+// simulates the owning peer's decision against its own per-key bucket
+// (limiterForKey) rather than always denying.
+func (pc *PeerClient) callPeer(peer string, keys []KeyRequest) []RateLimitSnapshot {
+	time.Sleep(2 * time.Millisecond)
+
+	out := make([]RateLimitSnapshot, len(keys))
+	for i, k := range keys {
+		decision, _ := pc.limiterForKey(k.Key).Allow(k.Key, k.Cost)
+		out[i] = RateLimitSnapshot{Key: k.Key, Remaining: decision.Remaining, ResetAt: decision.ResetAt}
+	}
+	return out
+}
+
+// limiterForKey returns the simulated bucket the owning peer holds for key,
+// creating one on first use. There's no real remote process to ask, so this
+// stands in for "the peer's own limiter state" rather than a canned answer.
+func (pc *PeerClient) limiterForKey(key string) *RateLimiter {
+	pc.limitersMu.Lock()
+	defer pc.limitersMu.Unlock()
+
+	rl, ok := pc.limiters[key]
+	if !ok {
+		rl = NewRateLimiter(1000)
+		pc.limiters[key] = rl
+	}
+	return rl
+}
+
+// Broadcast simulates pushing a snapshot to every peer: each push is only a
+// short sleep, the snapshot is sent nowhere, and no node keeps or consults
+// received snapshots, so non-owning nodes still forward every check to the
+// owner.
+func (pc *PeerClient) Broadcast(peers []string, snapshot RateLimitSnapshot) {
+	for _, peer := range peers {
+		go func(p string) {
+			time.Sleep(1 * time.Millisecond)
+			_ = p // simulated fire-and-forget push
+		}(peer)
+	}
+}
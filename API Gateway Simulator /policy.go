@@ -0,0 +1,58 @@
+package main
+
+import "time"
+
+// Algorithm identifies a pluggable rate-limit implementation a
+// RateLimitPolicy can select.
+type Algorithm string
+
+const (
+	AlgorithmTokenBucket   Algorithm = "token_bucket"
+	AlgorithmLeakyBucket   Algorithm = "leaky_bucket"
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+)
+
+// RateLimitPolicy configures the algorithm and limits applied to a route, so
+// different routes/models can express different quotas (e.g.
+// /chat/completions at 1000rps burst 100 vs /embeddings at 500rpm).
+type RateLimitPolicy struct {
+	Route     string
+	Algorithm Algorithm
+	Rate      float64       // units per second (token/leaky bucket), or per Window (sliding window)
+	Burst     int64         // token bucket burst / leaky bucket capacity
+	Window    time.Duration // sliding window size, defaults to a minute
+}
+
+// defaultPolicies returns the gateway's built-in per-route rate-limit
+// policies.
+func defaultPolicies() []RateLimitPolicy {
+	return []RateLimitPolicy{
+		{Route: "/chat/completions", Algorithm: AlgorithmTokenBucket, Rate: 1000, Burst: 100},
+		{Route: "/embeddings", Algorithm: AlgorithmSlidingWindow, Rate: 500, Window: time.Minute},
+	}
+}
+
+// buildLimiter constructs the Limiter implementation described by a policy.
+func buildLimiter(p RateLimitPolicy) Limiter {
+	switch p.Algorithm {
+	case AlgorithmLeakyBucket:
+		capacity := float64(p.Burst)
+		if capacity <= 0 {
+			capacity = p.Rate * 0.1
+		}
+		return NewLeakyBucketLimiter(p.Rate, capacity)
+	case AlgorithmSlidingWindow:
+		window := p.Window
+		if window <= 0 {
+			window = time.Minute
+		}
+		return NewSlidingWindowLimiter(int64(p.Rate), window)
+	default:
+		rl := NewRateLimiter(p.Rate)
+		if p.Burst > 0 {
+			rl.capacity = float64(p.Burst)
+			rl.tokens = rl.capacity
+		}
+		return rl
+	}
+}
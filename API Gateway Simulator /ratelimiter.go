@@ -3,17 +3,41 @@ package main
 import (
 	"math"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
-// RateLimiter implements token bucket rate limiting
+// Decision is the outcome of a rate-limit check, carrying enough detail for
+// the gateway to surface standard X-RateLimit-* / Retry-After headers.
+type Decision struct {
+	Allowed    bool
+	Remaining  int64
+	ResetAt    time.Time
+	RetryAfter time.Duration
+}
+
+// Limiter is implemented by every rate-limiting algorithm the gateway can
+// apply. key scopes the check (e.g. identity+resource for per-key limits);
+// cost is the number of units the request consumes, usually 1.
+type Limiter interface {
+	Allow(key string, cost int64) (Decision, error)
+}
+
+// RateLimiter implements token bucket rate limiting. A single RateLimiter
+// holds one bucket, so per-key use means constructing one RateLimiter per
+// key (see Gateway.Limiters); key is otherwise ignored.
+//
+// tokens and lastUpdate are refilled and consumed together under mu: packing
+// a fractional token count and a nanosecond timestamp into one atomic word
+// loses the precision either needs, and updating them via two independent
+// atomics let a concurrent Allow observe one post-CAS and the other still
+// stale, double-counting a refill window and over-admitting. A single mutex
+// around the whole refill+consume critical section closes that gap.
 type RateLimiter struct {
 	rate       float64 // tokens per second
 	capacity   float64
-	tokens     int64   // atomic
-	lastUpdate int64   // atomic unix nano
-	mu         sync.Mutex // for comparison
+	mu         sync.Mutex
+	tokens     float64
+	lastUpdate time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -22,55 +46,57 @@ func NewRateLimiter(rps float64) *RateLimiter {
 	return &RateLimiter{
 		rate:       rps,
 		capacity:   capacity,
-		tokens:     int64(capacity * 1e9), // store as nano for atomic
-		lastUpdate: time.Now().UnixNano(),
+		tokens:     capacity,
+		lastUpdate: time.Now(),
 	}
 }
 
-// Allow checks if a request is allowed (atomic version)
-func (rl *RateLimiter) Allow() bool {
-	now := time.Now().UnixNano()
-	last := atomic.LoadInt64(&rl.lastUpdate)
+// Allow implements Limiter for the token bucket algorithm. Refill and
+// consumption happen under a single lock so two concurrent callers can never
+// both observe enough tokens and both succeed in consuming them.
+func (rl *RateLimiter) Allow(key string, cost int64) (Decision, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
-	// Calculate elapsed time
-	elapsed := float64(now-last) / 1e9
+	now := time.Now()
+	elapsed := now.Sub(rl.lastUpdate).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
 
-	// Refill tokens
-	refill := elapsed * rl.rate
-	currentTokens := float64(atomic.LoadInt64(&rl.tokens)) / 1e9
-	newTokens := math.Min(rl.capacity, currentTokens+refill)
+	rl.tokens = math.Min(rl.capacity, rl.tokens+elapsed*rl.rate)
+	rl.lastUpdate = now
 
-	// Try to consume a token
-	if newTokens >= 1.0 {
-		newTokens -= 1.0
-		atomic.StoreInt64(&rl.tokens, int64(newTokens*1e9))
-		atomic.StoreInt64(&rl.lastUpdate, now)
-		return true
+	need := float64(cost)
+	if rl.tokens < need {
+		return Decision{
+			Allowed:    false,
+			Remaining:  int64(rl.tokens),
+			ResetAt:    rl.resetAt(rl.tokens),
+			RetryAfter: rl.retryAfter(rl.tokens, need),
+		}, nil
 	}
 
-	atomic.StoreInt64(&rl.lastUpdate, now)
-	return false
+	rl.tokens -= need
+	return Decision{Allowed: true, Remaining: int64(rl.tokens), ResetAt: rl.resetAt(rl.tokens)}, nil
 }
 
-// AllowMutex is the mutex-based version for comparison
-func (rl *RateLimiter) AllowMutex() bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	elapsed := now.Sub(time.Unix(0, atomic.LoadInt64(&rl.lastUpdate)))
-
-	refill := elapsed.Seconds() * rl.rate
-	currentTokens := float64(atomic.LoadInt64(&rl.tokens)) / 1e9
-	newTokens := math.Min(rl.capacity, currentTokens+refill)
-
-	if newTokens >= 1.0 {
-		newTokens -= 1.0
-		atomic.StoreInt64(&rl.tokens, int64(newTokens*1e9))
-		atomic.StoreInt64(&rl.lastUpdate, now.UnixNano())
-		return true
+// resetAt estimates when the bucket refills to full capacity. Caller must
+// hold rl.mu.
+func (rl *RateLimiter) resetAt(tokens float64) time.Time {
+	deficit := rl.capacity - tokens
+	if deficit <= 0 {
+		return time.Now()
 	}
+	return time.Now().Add(time.Duration(deficit / rl.rate * float64(time.Second)))
+}
 
-	atomic.StoreInt64(&rl.lastUpdate, now.UnixNano())
-	return false
-}
\ No newline at end of file
+// retryAfter estimates how long until `need` tokens are available. Caller
+// must hold rl.mu.
+func (rl *RateLimiter) retryAfter(tokens, need float64) time.Duration {
+	deficit := need - tokens
+	if deficit <= 0 {
+		return 0
+	}
+	return time.Duration(deficit / rl.rate * float64(time.Second))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindowLimiter implements the sliding-window-counter algorithm: it
+// tracks request counts in the current and previous fixed windows and
+// estimates the trailing-window count as a weighted blend of the two. This
+// avoids the burst-at-boundary problem of plain fixed windows without the
+// memory cost of a sliding log.
+type SlidingWindowLimiter struct {
+	limit  int64
+	window time.Duration
+
+	mu    sync.Mutex
+	state map[string]*slidingWindowState
+}
+
+type slidingWindowState struct {
+	windowStart time.Time
+	current     int64
+	previous    int64
+}
+
+// NewSlidingWindowLimiter creates a limiter admitting at most limit requests
+// per window.
+func NewSlidingWindowLimiter(limit int64, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		limit:  limit,
+		window: window,
+		state:  make(map[string]*slidingWindowState),
+	}
+}
+
+// Allow implements Limiter.
+func (sw *SlidingWindowLimiter) Allow(key string, cost int64) (Decision, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now()
+	s, ok := sw.state[key]
+	if !ok {
+		s = &slidingWindowState{windowStart: now}
+		sw.state[key] = s
+	}
+
+	elapsed := now.Sub(s.windowStart)
+	if elapsed >= sw.window {
+		windowsElapsed := int64(elapsed / sw.window)
+		if windowsElapsed == 1 {
+			s.previous = s.current
+		} else {
+			s.previous = 0
+		}
+		s.current = 0
+		s.windowStart = s.windowStart.Add(time.Duration(windowsElapsed) * sw.window)
+		elapsed = now.Sub(s.windowStart)
+	}
+
+	weight := 1 - float64(elapsed)/float64(sw.window)
+	estimate := float64(s.previous)*weight + float64(s.current)
+	resetAt := s.windowStart.Add(sw.window)
+
+	if estimate+float64(cost) <= float64(sw.limit) {
+		s.current += cost
+		remaining := sw.limit - int64(estimate) - cost
+		return Decision{Allowed: true, Remaining: remaining, ResetAt: resetAt}, nil
+	}
+
+	return Decision{
+		Allowed:    false,
+		Remaining:  0,
+		ResetAt:    resetAt,
+		RetryAfter: resetAt.Sub(now),
+	}, nil
+}
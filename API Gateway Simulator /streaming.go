@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	streamChunkCount = 8                     // simulated token chunks per completion
+	streamChunkDelay = 30 * time.Millisecond // inter-chunk delay
+	streamMaxRetries = 3                     // providers tried before giving up
+)
+
+// chatCompletionRequest is the subset of the /chat/completions body the
+// gateway inspects; everything else is opaque passthrough in this simulator.
+type chatCompletionRequest struct {
+	Stream bool `json:"stream"`
+}
+
+// StreamChunk is one simulated SSE frame: either a content delta or a
+// terminal error from the upstream provider.
+type StreamChunk struct {
+	Content string
+	Err     error
+	Done    bool
+}
+
+// simulateProviderStream simulates a streaming completion from p, emitting
+// streamChunkCount chunks with per-chunk delay on the returned channel. It
+// can fail before the first chunk (pre-stream failure) or before any later
+// chunk (mid-stream failure). The caller retries on another provider only
+// while no content chunk has reached the client; after that it surfaces the
+// error to the client instead of retrying. ctx cancellation stops the
+// simulated waits immediately.
+func (g *Gateway) simulateProviderStream(ctx context.Context, p *Provider) <-chan StreamChunk {
+	out := make(chan StreamChunk)
+
+	go func() {
+		defer close(out)
+
+		select {
+		case <-time.After(p.Latency):
+		case <-ctx.Done():
+			return
+		}
+
+		if rand.Float64() < p.ErrorRate {
+			out <- StreamChunk{Err: fmt.Errorf("simulated error")}
+			return
+		}
+
+		for i := 0; i < streamChunkCount; i++ {
+			select {
+			case <-time.After(streamChunkDelay):
+			case <-ctx.Done():
+				return
+			}
+
+			if rand.Float64() < p.ErrorRate/2 {
+				out <- StreamChunk{Err: fmt.Errorf("simulated mid-stream error")}
+				return
+			}
+
+			out <- StreamChunk{Content: fmt.Sprintf("token_%d ", i)}
+		}
+
+		out <- StreamChunk{Done: true}
+	}()
+
+	return out
+}
+
+// handleStreamRequest serves /chat/completions in streaming (SSE) mode. If
+// the upstream fails before any chunk reached the client, it transparently
+// retries on another provider; a failure after streaming has started is
+// surfaced to the client as an SSE error event followed by a [DONE] frame,
+// rather than resetting the connection.
+func (g *Gateway) handleStreamRequest(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	start := time.Now()
+	firstToken := false
+
+	for attempt := 0; attempt < streamMaxRetries; attempt++ {
+		provider, done, _ := g.SelectProvider()
+		streamed, err := g.relayStream(c, provider, start, &firstToken)
+		done(err != nil)
+
+		if err == nil {
+			return
+		}
+		if streamed {
+			// Bytes already reached the client; the error event/[DONE] was
+			// already written by relayStream, so there's nothing left to retry.
+			return
+		}
+
+		g.MarkFailure(provider.ID, "rate_limit")
+		providerErrors.WithLabelValues(provider.ID, "rate_limit").Inc()
+	}
+
+	writeSSEError(c, "all providers failed")
+}
+
+// relayStream streams one provider's simulated completion to the client.
+// streamed reports whether any content chunk reached the client, which
+// tells the caller whether a retry on another provider is still safe.
+func (g *Gateway) relayStream(c *gin.Context, provider *Provider, start time.Time, firstToken *bool) (streamed bool, err error) {
+	chunks := g.simulateProviderStream(c.Request.Context(), provider)
+
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			if streamed {
+				writeSSEError(c, chunk.Err.Error())
+			}
+			return streamed, chunk.Err
+		}
+
+		if chunk.Done {
+			fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+			c.Writer.Flush()
+			return streamed, nil
+		}
+
+		if !*firstToken {
+			streamTTFT.Observe(time.Since(start).Seconds())
+			*firstToken = true
+		}
+
+		c.SSEvent("message", gin.H{"content": chunk.Content, "provider": provider.ID})
+		c.Writer.Flush()
+		streamTokensTotal.WithLabelValues(provider.ID).Inc()
+		streamed = true
+	}
+
+	return streamed, nil
+}
+
+// writeSSEError emits an SSE error event followed by the terminal [DONE]
+// frame clients expect instead of a reset connection.
+func writeSSEError(c *gin.Context, message string) {
+	c.SSEvent("error", gin.H{"error": message})
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}